@@ -0,0 +1,77 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"testing"
+
+	msgpack "github.com/vmihailenco/msgpack/v5"
+)
+
+type autoInternRec struct {
+	KeyOne string
+	KeyTwo string
+}
+
+func TestAutoInternStructFieldNames(t *testing.T) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.AutoInternStructFieldNames(true)
+	dec := msgpack.NewDecoder(&buf)
+	dec.AutoInternStructFieldNames(true)
+
+	want := []autoInternRec{
+		{KeyOne: "aaa", KeyTwo: "bbb"},
+		{KeyOne: "ccc", KeyTwo: "ddd"},
+	}
+	for _, rec := range want {
+		if err := enc.Encode(rec); err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+	}
+
+	for i, rec := range want {
+		var got autoInternRec
+		if err := dec.Decode(&got); err != nil {
+			t.Fatalf("Decode #%d: %v", i, err)
+		}
+		if got != rec {
+			t.Fatalf("#%d: got %#v, want %#v", i, got, rec)
+		}
+	}
+}
+
+// TestAutoInternMapKeysAcrossMultipleEncodeCalls reproduces the
+// corruption reported against interface{}-typed map values: decoding
+// a msgpack map into map[string]interface{} must not let the plain
+// string values grow the decoder's intern table, or later
+// auto-interned keys drift out of sync with the peer encoder's table.
+func TestAutoInternMapKeysAcrossMultipleEncodeCalls(t *testing.T) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.AutoInternMapKeys(true)
+	dec := msgpack.NewDecoder(&buf)
+	dec.AutoInternMapKeys(true)
+
+	want := []map[string]interface{}{
+		{"keyone": "longstringvalueone"},
+		{"keytwo": "shortval2"},
+		{"keytwo": "shortval3"},
+	}
+	for _, m := range want {
+		if err := enc.Encode(m); err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+	}
+
+	for i, m := range want {
+		var got map[string]interface{}
+		if err := dec.Decode(&got); err != nil {
+			t.Fatalf("Decode #%d: %v", i, err)
+		}
+		for k, v := range m {
+			if got[k] != v {
+				t.Fatalf("#%d: got %#v, want %#v", i, got, m)
+			}
+		}
+	}
+}
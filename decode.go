@@ -16,7 +16,18 @@ import (
 type Decoder struct {
 	s *bufio.Reader
 
-	intern []string
+	intern     []string
+	internDict *InternDict
+
+	extRegistryOverride *ExtRegistry
+
+	internLimit           int
+	internPolicy          InternPolicy
+	internPendingReassign bool
+	internReassignIdx     int
+
+	autoInternMapKeys          bool
+	autoInternStructFieldNames bool
 }
 
 // NewDecoder returns a Decoder that reads from r.
@@ -322,9 +333,13 @@ func (d *Decoder) decodeFloat64WithCode(c codes.Code) (float64, error) {
 // DecodeValue reads one msgpack value into v, dispatching on its
 // reflect.Kind.
 func (d *Decoder) DecodeValue(v reflect.Value) error {
+	if extID, h, ok := d.extRegistry().lookupType(v.Type()); ok {
+		return d.decodeExtValue(v, extID, h)
+	}
+
 	switch v.Kind() {
 	case reflect.Interface:
-		return decodeInterfaceValue(d, v)
+		return decodeInternedInterfaceValue(d, v)
 	case reflect.Ptr:
 		if v.IsNil() {
 			v.Set(reflect.New(v.Type().Elem()))
@@ -465,7 +480,7 @@ func (d *Decoder) decodeMap(v reflect.Value) error {
 	for i := 0; i < n; i++ {
 		var key reflect.Value
 		if kt.Kind() == reflect.String {
-			s, err := d.DecodeString()
+			s, err := d.decodeAutoInternedString(d.autoInternMapKeys)
 			if err != nil {
 				return err
 			}
@@ -504,7 +519,7 @@ func (d *Decoder) decodeStruct(v reflect.Value) error {
 	}
 
 	for i := 0; i < n; i++ {
-		name, err := d.DecodeString()
+		name, err := d.decodeAutoInternedString(d.autoInternStructFieldNames)
 		if err != nil {
 			return err
 		}
@@ -541,7 +556,7 @@ func (d *Decoder) decodeStruct(v reflect.Value) error {
 // struct fields present on the wire but absent from the Go type.
 func (d *Decoder) skipValue() error {
 	var discard interface{}
-	return decodeInterfaceValue(d, reflect.ValueOf(&discard).Elem())
+	return decodeInternedInterfaceValue(d, reflect.ValueOf(&discard).Elem())
 }
 
 // decodeInterfaceValue decodes an arbitrary msgpack value into v, an
@@ -595,7 +610,7 @@ func decodeInterfaceValueWithCode(d *Decoder, v reflect.Value, c codes.Code) err
 		out := make([]interface{}, n)
 		for i := range out {
 			elem := reflect.New(v.Type()).Elem()
-			if err := decodeInterfaceValue(d, elem); err != nil {
+			if err := decodeInternedInterfaceValue(d, elem); err != nil {
 				return err
 			}
 			out[i] = elem.Interface()
@@ -609,12 +624,12 @@ func decodeInterfaceValueWithCode(d *Decoder, v reflect.Value, c codes.Code) err
 		}
 		out := make(map[string]interface{}, n)
 		for i := 0; i < n; i++ {
-			key, err := d.DecodeString()
+			key, err := d.decodeAutoInternedString(d.autoInternMapKeys)
 			if err != nil {
 				return err
 			}
 			elem := reflect.New(v.Type()).Elem()
-			if err := decodeInterfaceValue(d, elem); err != nil {
+			if err := decodeInternedInterfaceValue(d, elem); err != nil {
 				return err
 			}
 			out[key] = elem.Interface()
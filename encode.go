@@ -13,11 +13,27 @@ import (
 )
 
 // Encoder writes msgpack-encoded values to an underlying io.Writer. A
-// single Encoder is not safe for concurrent use.
+// single Encoder is not safe for concurrent use; share state between
+// Encoders via UseInternDict instead.
 type Encoder struct {
 	w *bufio.Writer
 
-	intern map[string]int
+	intern     map[string]int
+	internDict *InternDict
+
+	extRegistryOverride *ExtRegistry
+
+	internNext   int
+	internLimit  int
+	internPolicy InternPolicy
+	internLRU    map[string]uint64
+	internSeq    uint64
+
+	internHits   int
+	internMisses int
+
+	autoInternMapKeys          bool
+	autoInternStructFieldNames bool
 }
 
 // NewEncoder returns an Encoder that writes to w.
@@ -197,6 +213,10 @@ func (e *Encoder) EncodeValue(v reflect.Value) error {
 		return e.EncodeNil()
 	}
 
+	if extID, h, ok := e.extRegistry().lookupType(v.Type()); ok {
+		return e.encodeExtValue(extID, h, v)
+	}
+
 	switch v.Kind() {
 	case reflect.Interface, reflect.Ptr:
 		if v.IsNil() {
@@ -281,9 +301,14 @@ func (e *Encoder) encodeMapValue(v reflect.Value) error {
 		return err
 	}
 
+	kt := v.Type().Key()
 	iter := v.MapRange()
 	for iter.Next() {
-		if err := e.EncodeValue(iter.Key()); err != nil {
+		if e.autoInternMapKeys && kt.Kind() == reflect.String {
+			if err := encodeInternedStringValue(e, iter.Key()); err != nil {
+				return err
+			}
+		} else if err := e.EncodeValue(iter.Key()); err != nil {
 			return err
 		}
 		if err := e.EncodeValue(iter.Value()); err != nil {
@@ -340,7 +365,7 @@ func (e *Encoder) encodeStructValue(v reflect.Value) error {
 	}
 
 	for _, f := range fields {
-		if err := e.EncodeString(f.name); err != nil {
+		if err := e.encodeAutoInternedString(f.name, e.autoInternStructFieldNames); err != nil {
 			return err
 		}
 
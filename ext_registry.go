@@ -0,0 +1,207 @@
+package msgpack
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/vmihailenco/msgpack/v5/codes"
+)
+
+// ExtEncodeFunc writes v as the payload of an ext record, without its header.
+type ExtEncodeFunc func(e *Encoder, v reflect.Value) error
+
+// ExtDecodeFunc reads the n-byte payload of an ext record into a Go value.
+type ExtDecodeFunc func(d *Decoder, n int) (interface{}, error)
+
+// extHandler pairs one ext type's hooks with the reflect.Type EncodeValue
+// dispatches on; typ is nil for the built-in interned-string handler.
+type extHandler struct {
+	typ    reflect.Type
+	encode ExtEncodeFunc
+	decode ExtDecodeFunc
+}
+
+// ExtRegistry maps int8 msgpack ext type IDs to user-defined encode/decode
+// hooks. Attach one via UseExtRegistry, or register into DefaultExtRegistry.
+type ExtRegistry struct {
+	byID   map[int8]*extHandler
+	byType map[reflect.Type]int8
+}
+
+// NewExtRegistry returns an ExtRegistry pre-seeded with the interned-string
+// subsystem's handler, for introspection only.
+func NewExtRegistry() *ExtRegistry {
+	r := &ExtRegistry{
+		byID:   make(map[int8]*extHandler),
+		byType: make(map[reflect.Type]int8),
+	}
+	r.byID[internedStringExtID] = &extHandler{
+		decode: func(d *Decoder, n int) (interface{}, error) {
+			idx, err := d.decodeInternedStringIndex(n)
+			if err != nil {
+				return nil, err
+			}
+			return d.internedStringAtIndex(idx)
+		},
+	}
+	return r
+}
+
+// DefaultExtRegistry is consulted by any Encoder or Decoder that has
+// not had its own ExtRegistry attached via UseExtRegistry.
+var DefaultExtRegistry = NewExtRegistry()
+
+// Register associates extID with typ, encode and decode. It panics if
+// extID is reserved or already registered.
+func (r *ExtRegistry) Register(extID int8, typ reflect.Type, encode ExtEncodeFunc, decode ExtDecodeFunc) {
+	switch extID {
+	case internedStringExtID, internedResetExtID, internedReassignExtID:
+		panic(fmt.Sprintf("msgpack: ext id=%d is reserved by the interned-string subsystem", extID))
+	}
+	if _, ok := r.byID[extID]; ok {
+		panic(fmt.Sprintf("msgpack: ext id=%d is already registered", extID))
+	}
+	r.byID[extID] = &extHandler{typ: typ, encode: encode, decode: decode}
+	r.byType[typ] = extID
+}
+
+func (r *ExtRegistry) lookupID(extID int8) (*extHandler, bool) {
+	h, ok := r.byID[extID]
+	return h, ok
+}
+
+func (r *ExtRegistry) lookupType(typ reflect.Type) (int8, *extHandler, bool) {
+	extID, ok := r.byType[typ]
+	if !ok {
+		return 0, nil, false
+	}
+	return extID, r.byID[extID], true
+}
+
+// UseExtRegistry attaches r to the encoder, taking priority over DefaultExtRegistry.
+func (e *Encoder) UseExtRegistry(r *ExtRegistry) {
+	e.extRegistryOverride = r
+}
+
+// UseExtRegistry attaches r to the decoder; it must match the peer Encoder's registry.
+func (d *Decoder) UseExtRegistry(r *ExtRegistry) {
+	d.extRegistryOverride = r
+}
+
+func (e *Encoder) extRegistry() *ExtRegistry {
+	if e.extRegistryOverride != nil {
+		return e.extRegistryOverride
+	}
+	return DefaultExtRegistry
+}
+
+func (d *Decoder) extRegistry() *ExtRegistry {
+	if d.extRegistryOverride != nil {
+		return d.extRegistryOverride
+	}
+	return DefaultExtRegistry
+}
+
+// encodeExtValue buffers h's encode hook output, since the ext header must
+// carry its length, then writes it as an ext record tagged extID.
+func (e *Encoder) encodeExtValue(extID int8, h *extHandler, v reflect.Value) error {
+	var buf bytes.Buffer
+	sub := &Encoder{w: bufio.NewWriter(&buf), extRegistryOverride: e.extRegistryOverride}
+	if err := h.encode(sub, v); err != nil {
+		return err
+	}
+	if err := sub.w.Flush(); err != nil {
+		return err
+	}
+
+	payload := buf.Bytes()
+	if err := e.writeExtHeader(extID, len(payload)); err != nil {
+		return err
+	}
+	_, err := e.w.Write(payload)
+	return err
+}
+
+// decodeExtValue reads an ext record for a concrete, registered Go type,
+// checking its ext ID matches wantID before running h's decode hook.
+func (d *Decoder) decodeExtValue(v reflect.Value, wantID int8, h *extHandler) error {
+	c, err := d.readCode()
+	if err != nil {
+		return err
+	}
+
+	switch c {
+	case codes.FixExt1, codes.FixExt2, codes.FixExt4, codes.FixExt8, codes.FixExt16,
+		codes.Ext8, codes.Ext16, codes.Ext32:
+	default:
+		return fmt.Errorf("msgpack: invalid code=%x decoding ext %s", c, v.Type())
+	}
+
+	gotID, n, err := d.extHeader(c)
+	if err != nil {
+		return err
+	}
+	if gotID != wantID {
+		return fmt.Errorf("msgpack: ext id=%d decoding %s, wanted id=%d", gotID, v.Type(), wantID)
+	}
+
+	val, err := h.decode(d, n)
+	if err != nil {
+		return err
+	}
+	v.Set(reflect.ValueOf(val))
+	return nil
+}
+
+func (e *Encoder) writeExtHeader(extID int8, n int) error {
+	switch n {
+	case 1:
+		if err := e.writeCode(codes.FixExt1); err != nil {
+			return err
+		}
+	case 2:
+		if err := e.writeCode(codes.FixExt2); err != nil {
+			return err
+		}
+	case 4:
+		if err := e.writeCode(codes.FixExt4); err != nil {
+			return err
+		}
+	case 8:
+		if err := e.writeCode(codes.FixExt8); err != nil {
+			return err
+		}
+	case 16:
+		if err := e.writeCode(codes.FixExt16); err != nil {
+			return err
+		}
+	default:
+		switch {
+		case n < math.MaxUint8:
+			if err := e.writeCode(codes.Ext8); err != nil {
+				return err
+			}
+			if err := e.w.WriteByte(byte(n)); err != nil {
+				return err
+			}
+		case n < math.MaxUint16:
+			if err := e.writeCode(codes.Ext16); err != nil {
+				return err
+			}
+			if err := e.write2(uint16(n)); err != nil {
+				return err
+			}
+		default:
+			if err := e.writeCode(codes.Ext32); err != nil {
+				return err
+			}
+			if err := e.write4(uint32(n)); err != nil {
+				return err
+			}
+		}
+	}
+	return e.w.WriteByte(byte(extID))
+}
@@ -0,0 +1,93 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	msgpack "github.com/vmihailenco/msgpack/v5"
+)
+
+type extUUID [4]byte
+
+func newUUIDRegistry(extID int8) *msgpack.ExtRegistry {
+	r := msgpack.NewExtRegistry()
+	r.Register(extID, reflect.TypeOf(extUUID{}),
+		func(e *msgpack.Encoder, v reflect.Value) error {
+			u := v.Interface().(extUUID)
+			return e.EncodeBytes(u[:])
+		},
+		func(d *msgpack.Decoder, n int) (interface{}, error) {
+			b, err := d.DecodeBytes()
+			if err != nil {
+				return nil, err
+			}
+			var u extUUID
+			copy(u[:], b)
+			return u, nil
+		},
+	)
+	return r
+}
+
+type extUUIDRec struct {
+	ID   extUUID
+	Name string
+}
+
+func TestExtRegistryStructField(t *testing.T) {
+	reg := newUUIDRegistry(5)
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.UseExtRegistry(reg)
+	dec := msgpack.NewDecoder(&buf)
+	dec.UseExtRegistry(reg)
+
+	want := extUUIDRec{ID: extUUID{1, 2, 3, 4}, Name: "hello"}
+	if err := enc.Encode(want); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	var got extUUIDRec
+	if err := dec.Decode(&got); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if got != want {
+		t.Fatalf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestExtRegistryInterfaceValue(t *testing.T) {
+	reg := newUUIDRegistry(5)
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.UseExtRegistry(reg)
+	dec := msgpack.NewDecoder(&buf)
+	dec.UseExtRegistry(reg)
+
+	want := map[string]interface{}{"id": extUUID{5, 6, 7, 8}}
+	if err := enc.Encode(want); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	var got map[string]interface{}
+	if err := dec.Decode(&got); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if got["id"] != want["id"] {
+		t.Fatalf("got %#v, want %#v", got["id"], want["id"])
+	}
+}
+
+func TestExtRegistryRejectsReservedIDs(t *testing.T) {
+	reg := msgpack.NewExtRegistry()
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Register with a reserved ext id did not panic")
+		}
+	}()
+	reg.Register(-128, reflect.TypeOf(extUUID{}), nil, nil)
+}
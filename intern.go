@@ -14,8 +14,128 @@ const minInternedStringLen = 3
 
 var internedStringExtID int8 = -128
 
+// internedResetExtID and internedReassignExtID are the control directives
+// SetInternLimit emits under InternPolicyReset/InternPolicyLRU.
+var (
+	internedResetExtID    int8 = -127
+	internedReassignExtID int8 = -126
+)
+
 var errUnexpectedCode = errors.New("msgpack: unexpected code")
 
+// InternPolicy selects what an Encoder or Decoder does once its
+// per-stream intern table reaches the cap set by SetInternLimit.
+type InternPolicy int
+
+const (
+	// InternPolicyReject stops interning new strings once the table
+	// is full; they are still written out as plain strings.
+	InternPolicyReject InternPolicy = iota
+
+	// InternPolicyLRU evicts the least-recently-used entry to make
+	// room for a new one, emitting an internedReassignExtID record so
+	// the peer Decoder frees and reuses the same index.
+	InternPolicyLRU
+
+	// InternPolicyReset flushes the entire table, emitting an
+	// internedResetExtID record, and restarts indices at 0.
+	InternPolicyReset
+)
+
+// InternStats reports how an Encoder's interned-string table has been
+// used, for tuning SetInternLimit.
+type InternStats struct {
+	Hits   int
+	Misses int
+}
+
+// InternStats returns the number of strings encoded by reusing an
+// existing interned index (Hits) versus assigning a new one (Misses).
+func (e *Encoder) InternStats() InternStats {
+	return InternStats{Hits: e.internHits, Misses: e.internMisses}
+}
+
+// SetInternLimit bounds the encoder's per-stream intern table to at most
+// maxEntries (0 or negative removes the limit), handling overflow per policy.
+func (e *Encoder) SetInternLimit(maxEntries int, policy InternPolicy) {
+	e.internLimit = maxEntries
+	e.internPolicy = policy
+	if policy == InternPolicyLRU {
+		e.backfillInternLRU()
+	}
+}
+
+// backfillInternLRU gives every existing e.intern entry an LRU timestamp, so
+// internLRUVictim can evict them even though internTouch never ran for
+// strings interned before switching to InternPolicyLRU.
+func (e *Encoder) backfillInternLRU() {
+	if len(e.intern) == 0 {
+		return
+	}
+	if e.internLRU == nil {
+		e.internLRU = make(map[string]uint64)
+	}
+	for s := range e.intern {
+		if _, ok := e.internLRU[s]; ok {
+			continue
+		}
+		e.internSeq++
+		e.internLRU[s] = e.internSeq
+	}
+}
+
+// SetInternLimit bounds the decoder's per-stream intern table to at most
+// maxEntries; policy is accepted only to mirror the peer Encoder's call and
+// has no effect here, since eviction is driven entirely by the
+// reassign/reset directives the Encoder emits on the wire.
+func (d *Decoder) SetInternLimit(maxEntries int, policy InternPolicy) {
+	d.internLimit = maxEntries
+	d.internPolicy = policy
+}
+
+// AutoInternMapKeys routes every string-typed map key through the
+// interned-string encoder instead of requiring a ",intern" tag; the peer
+// Decoder must set it identically.
+func (e *Encoder) AutoInternMapKeys(on bool) {
+	e.autoInternMapKeys = on
+}
+
+// AutoInternStructFieldNames is AutoInternMapKeys for struct field names.
+func (e *Encoder) AutoInternStructFieldNames(on bool) {
+	e.autoInternStructFieldNames = on
+}
+
+// AutoInternMapKeys is the decode side of Encoder.AutoInternMapKeys.
+func (d *Decoder) AutoInternMapKeys(on bool) {
+	d.autoInternMapKeys = on
+}
+
+// AutoInternStructFieldNames is the decode side of Encoder.AutoInternStructFieldNames.
+func (d *Decoder) AutoInternStructFieldNames(on bool) {
+	d.autoInternStructFieldNames = on
+}
+
+// encodeAutoInternedString writes s as a plain string unless auto is set, in
+// which case it goes through the interned-string encoder.
+func (e *Encoder) encodeAutoInternedString(s string, auto bool) error {
+	if !auto {
+		return e.EncodeString(s)
+	}
+	return encodeInternedStringValue(e, reflect.ValueOf(s))
+}
+
+// decodeAutoInternedString is the decode side of encodeAutoInternedString.
+func (d *Decoder) decodeAutoInternedString(auto bool) (string, error) {
+	if !auto {
+		return d.DecodeString()
+	}
+	c, err := d.readCode()
+	if err != nil {
+		return "", err
+	}
+	return d.decodeInternedString(c)
+}
+
 func encodeInternedInterfaceValue(e *Encoder, v reflect.Value) error {
 	if v.IsNil() {
 		return e.EncodeNil()
@@ -33,27 +153,156 @@ func encodeInternedStringValue(e *Encoder, v reflect.Value) error {
 
 	// Interned string takes at least 3 bytes. Plain string 1 byte + string length.
 	if len(s) >= minInternedStringLen {
+		if e.internDict != nil {
+			return e.encodeInternedStringValueWithDict(s)
+		}
+
 		if idx, ok := e.intern[s]; ok {
+			e.internHits++
+			e.internTouch(s)
 			return e.encodeInternedStringIndex(idx)
 		}
 
-		if e.intern == nil {
-			e.intern = make(map[string]int)
+		idx, intern, err := e.internNewIndex(s)
+		if err != nil {
+			return err
+		}
+		if intern {
+			e.internMisses++
+			e.internStore(s, idx)
 		}
+	}
+
+	return e.EncodeString(s)
+}
+
+// encodeInternedStringValueWithDict is encodeInternedStringValue's path for a
+// shared InternDict; new strings fall back to the per-stream table, offset
+// past dict's length so the two index spaces never collide.
+func (e *Encoder) encodeInternedStringValueWithDict(s string) error {
+	if idx, ok := e.internDict.Lookup(s); ok {
+		e.internHits++
+		return e.encodeInternedStringIndex(idx)
+	}
+
+	if _, added := e.internDict.Intern(s); added {
+		e.internMisses++
+		return e.EncodeString(s)
+	}
 
-		idx := len(e.intern)
-		e.intern[s] = idx
+	if idx, ok := e.intern[s]; ok {
+		e.internHits++
+		e.internTouch(s)
+		return e.encodeInternedStringIndex(e.internDict.Len() + idx)
+	}
+
+	idx, intern, err := e.internNewIndex(s)
+	if err != nil {
+		return err
+	}
+	if intern {
+		e.internMisses++
+		e.internStore(s, idx)
 	}
 
 	return e.EncodeString(s)
 }
 
+// internNewIndex decides the index a newly-seen string s should take
+// in e.intern, writing any control record needed to keep a peer
+// Decoder in sync. intern is false when the table is full under
+// InternPolicyReject, in which case the caller must fall back to
+// writing s as a plain string without an index.
+func (e *Encoder) internNewIndex(s string) (idx int, intern bool, err error) {
+	if e.internLimit <= 0 || len(e.intern) < e.internLimit {
+		idx = e.internNext
+		e.internNext++
+		return idx, true, nil
+	}
+
+	switch e.internPolicy {
+	case InternPolicyLRU:
+		victim, ok := e.internLRUVictim()
+		if !ok {
+			return 0, false, nil
+		}
+		idx = e.intern[victim]
+		delete(e.intern, victim)
+		delete(e.internLRU, victim)
+		if err := e.encodeExtIndex(internedReassignExtID, idx); err != nil {
+			return 0, false, err
+		}
+		return idx, true, nil
+	case InternPolicyReset:
+		if err := e.writeInternReset(); err != nil {
+			return 0, false, err
+		}
+		e.intern = nil
+		e.internLRU = nil
+		e.internNext = 1
+		return 0, true, nil
+	default: // InternPolicyReject
+		return 0, false, nil
+	}
+}
+
+func (e *Encoder) internStore(s string, idx int) {
+	if e.intern == nil {
+		e.intern = make(map[string]int)
+	}
+	e.intern[s] = idx
+	e.internTouch(s)
+}
+
+// internTouch records s as most-recently-used; a no-op outside InternPolicyLRU.
+func (e *Encoder) internTouch(s string) {
+	if e.internPolicy != InternPolicyLRU {
+		return
+	}
+	if e.internLRU == nil {
+		e.internLRU = make(map[string]uint64)
+	}
+	e.internSeq++
+	e.internLRU[s] = e.internSeq
+}
+
+// internLRUVictim returns the least-recently-used entry in e.intern.
+func (e *Encoder) internLRUVictim() (string, bool) {
+	var victim string
+	var oldest uint64
+	found := false
+	for s, seq := range e.internLRU {
+		if !found || seq < oldest {
+			victim, oldest, found = s, seq, true
+		}
+	}
+	return victim, found
+}
+
+// writeInternReset emits the internedResetExtID directive as a throwaway
+// byte, since msgpack ext records have no zero-length form.
+func (e *Encoder) writeInternReset() error {
+	if err := e.writeCode(codes.FixExt1); err != nil {
+		return err
+	}
+	if err := e.w.WriteByte(byte(internedResetExtID)); err != nil {
+		return err
+	}
+	return e.w.WriteByte(0)
+}
+
 func (e *Encoder) encodeInternedStringIndex(idx int) error {
+	return e.encodeExtIndex(internedStringExtID, idx)
+}
+
+// encodeExtIndex writes idx as the payload of the smallest FixExt1/2/4
+// record tagged extID that fits.
+func (e *Encoder) encodeExtIndex(extID int8, idx int) error {
 	if idx < math.MaxUint8 {
 		if err := e.writeCode(codes.FixExt1); err != nil {
 			return err
 		}
-		if err := e.w.WriteByte(byte(internedStringExtID)); err != nil {
+		if err := e.w.WriteByte(byte(extID)); err != nil {
 			return err
 		}
 		return e.w.WriteByte(byte(idx))
@@ -63,7 +312,7 @@ func (e *Encoder) encodeInternedStringIndex(idx int) error {
 		if err := e.writeCode(codes.FixExt2); err != nil {
 			return err
 		}
-		if err := e.w.WriteByte(byte(internedStringExtID)); err != nil {
+		if err := e.w.WriteByte(byte(extID)); err != nil {
 			return err
 		}
 		if err := e.w.WriteByte(byte(idx >> 8)); err != nil {
@@ -76,7 +325,7 @@ func (e *Encoder) encodeInternedStringIndex(idx int) error {
 		if err := e.writeCode(codes.FixExt4); err != nil {
 			return err
 		}
-		if err := e.w.WriteByte(byte(internedStringExtID)); err != nil {
+		if err := e.w.WriteByte(byte(extID)); err != nil {
 			return err
 		}
 		if err := e.w.WriteByte(byte(idx >> 24)); err != nil {
@@ -96,18 +345,22 @@ func (e *Encoder) encodeInternedStringIndex(idx int) error {
 
 //------------------------------------------------------------------------------
 
+// decodeInternedInterfaceValue decodes one value into v, an addressable
+// interface{}, recognizing interned strings and ExtRegistry-registered
+// extension types in addition to the plain shapes decodeInterfaceValue
+// understands; it never tracks a plain string into the intern table.
 func decodeInternedInterfaceValue(d *Decoder, v reflect.Value) error {
 	c, err := d.readCode()
 	if err != nil {
 		return err
 	}
 
-	s, err := d.decodeInternedString(c)
+	val, err := d.decodeInternedValue(c, false)
 	if err == nil {
-		v.Set(reflect.ValueOf(s))
+		v.Set(reflect.ValueOf(val))
 		return nil
 	}
-	if err != nil && err != errUnexpectedCode {
+	if err != errUnexpectedCode {
 		return err
 	}
 
@@ -136,51 +389,115 @@ func decodeInternedStringValue(d *Decoder, v reflect.Value) error {
 	return nil
 }
 
+// decodeInternedString is decodeInternedValue narrowed to the string
+// result callers expecting only a string (tagged ",intern" fields) need.
 func (d *Decoder) decodeInternedString(c codes.Code) (string, error) {
-	if codes.IsFixedString(c) {
-		n := int(c & codes.FixedStrMask)
-		return d.decodeInternedStringWithLen(n)
+	val, err := d.decodeInternedValue(c, true)
+	if err != nil {
+		return "", err
 	}
+	s, ok := val.(string)
+	if !ok {
+		return "", fmt.Errorf("msgpack: ext produced value of type %T, wanted string", val)
+	}
+	return s, nil
+}
 
-	switch c {
-	case codes.FixExt1, codes.FixExt2, codes.FixExt4:
-		typeID, length, err := d.extHeader(c)
-		if err != nil {
-			return "", err
-		}
-		if typeID != internedStringExtID {
-			err := fmt.Errorf("msgpack: got ext type=%d, wanted %d",
-				typeID, internedStringExtID)
-			return "", err
+// decodeInternedValue decodes one logical value starting at already-read
+// code c: a plain string/bin, an interned-string index, or an
+// ExtRegistry-registered extension type, applying any
+// internedResetExtID/internedReassignExtID control records in place first.
+// It returns errUnexpectedCode, without consuming past c, if c is none of
+// the above. track gates whether a plain string/bin literal grows the
+// per-stream intern table; see decodeInternedStringWithLen.
+func (d *Decoder) decodeInternedValue(c codes.Code, track bool) (interface{}, error) {
+	for {
+		if codes.IsFixedString(c) {
+			n := int(c & codes.FixedStrMask)
+			return d.decodeInternedStringWithLen(n, track)
 		}
 
-		idx, err := d.decodeInternedStringIndex(length)
-		if err != nil {
-			return "", err
+		switch c {
+		case codes.FixExt1, codes.FixExt2, codes.FixExt4, codes.FixExt8, codes.FixExt16,
+			codes.Ext8, codes.Ext16, codes.Ext32:
+			typeID, length, err := d.extHeader(c)
+			if err != nil {
+				return nil, err
+			}
+
+			switch typeID {
+			case internedResetExtID:
+				if _, err := d.readN(length); err != nil {
+					return nil, err
+				}
+				d.applyInternReset()
+			case internedReassignExtID:
+				idx, err := d.decodeInternedStringIndex(length)
+				if err != nil {
+					return nil, err
+				}
+				if err := d.applyInternReassign(idx); err != nil {
+					return nil, err
+				}
+			case internedStringExtID:
+				idx, err := d.decodeInternedStringIndex(length)
+				if err != nil {
+					return nil, err
+				}
+				return d.internedStringAtIndex(idx)
+			default:
+				h, ok := d.extRegistry().lookupID(typeID)
+				if !ok {
+					return nil, fmt.Errorf("msgpack: no ext handler registered for type=%d", typeID)
+				}
+				return h.decode(d, length)
+			}
+
+			if c, err = d.readCode(); err != nil {
+				return nil, err
+			}
+			continue
+		case codes.Str8, codes.Bin8:
+			n, err := d.uint8()
+			if err != nil {
+				return nil, err
+			}
+			return d.decodeInternedStringWithLen(int(n), track)
+		case codes.Str16, codes.Bin16:
+			n, err := d.uint16()
+			if err != nil {
+				return nil, err
+			}
+			return d.decodeInternedStringWithLen(int(n), track)
+		case codes.Str32, codes.Bin32:
+			n, err := d.uint32()
+			if err != nil {
+				return nil, err
+			}
+			return d.decodeInternedStringWithLen(int(n), track)
 		}
 
-		return d.internedStringAtIndex(idx)
-	case codes.Str8, codes.Bin8:
-		n, err := d.uint8()
-		if err != nil {
-			return "", err
-		}
-		return d.decodeInternedStringWithLen(int(n))
-	case codes.Str16, codes.Bin16:
-		n, err := d.uint16()
-		if err != nil {
-			return "", err
-		}
-		return d.decodeInternedStringWithLen(int(n))
-	case codes.Str32, codes.Bin32:
-		n, err := d.uint32()
-		if err != nil {
-			return "", err
-		}
-		return d.decodeInternedStringWithLen(int(n))
+		return nil, errUnexpectedCode
 	}
+}
 
-	return "", errUnexpectedCode
+// applyInternReset flushes the per-stream intern table in response to
+// a peer Encoder's InternPolicyReset directive.
+func (d *Decoder) applyInternReset() {
+	d.intern = nil
+	d.internPendingReassign = false
+}
+
+// applyInternReassign records that idx has been freed by a peer
+// Encoder's InternPolicyLRU eviction, so the next new string seen
+// reuses idx instead of appending a fresh one.
+func (d *Decoder) applyInternReassign(idx int) error {
+	if idx < 0 || idx >= len(d.intern) {
+		return fmt.Errorf("msgpack: intern reassign index=%d does not exist", idx)
+	}
+	d.internReassignIdx = idx
+	d.internPendingReassign = true
+	return nil
 }
 
 func (d *Decoder) decodeInternedStringIndex(length int) (int, error) {
@@ -212,6 +529,17 @@ func (d *Decoder) decodeInternedStringIndex(length int) (int, error) {
 }
 
 func (d *Decoder) internedStringAtIndex(idx int) (string, error) {
+	if d.internDict != nil {
+		if s, ok := d.internDict.At(idx); ok {
+			return s, nil
+		}
+		if local := idx - d.internDict.Len(); local >= 0 && local < len(d.intern) {
+			return d.intern[local], nil
+		}
+		err := fmt.Errorf("msgpack: intern string with index=%d does not exist", idx)
+		return "", err
+	}
+
 	if idx >= len(d.intern) {
 		err := fmt.Errorf("msgpack: intern string with index=%d does not exist", idx)
 		return "", err
@@ -219,7 +547,9 @@ func (d *Decoder) internedStringAtIndex(idx int) (string, error) {
 	return d.intern[idx], nil
 }
 
-func (d *Decoder) decodeInternedStringWithLen(n int) (string, error) {
+// decodeInternedStringWithLen reads an n-byte plain string, growing the
+// per-stream intern table only when track is set (see decodeInternedValue).
+func (d *Decoder) decodeInternedStringWithLen(n int, track bool) (string, error) {
 	if n <= 0 {
 		return "", nil
 	}
@@ -229,9 +559,33 @@ func (d *Decoder) decodeInternedStringWithLen(n int) (string, error) {
 		return "", err
 	}
 
-	if len(s) >= minInternedStringLen {
-		d.intern = append(d.intern, s)
+	if track && len(s) >= minInternedStringLen {
+		if d.internDict != nil {
+			if _, ok := d.internDict.Lookup(s); !ok {
+				if _, added := d.internDict.Intern(s); !added {
+					d.internStoreLocal(s)
+				}
+			}
+		} else {
+			d.internStoreLocal(s)
+		}
 	}
 
 	return s, nil
 }
+
+// internStoreLocal records s in the per-stream intern table, either
+// overwriting the slot a preceding internedReassignExtID directive
+// freed, or appending a new entry subject to SetInternLimit under
+// InternPolicyReject.
+func (d *Decoder) internStoreLocal(s string) {
+	if d.internPendingReassign {
+		d.intern[d.internReassignIdx] = s
+		d.internPendingReassign = false
+		return
+	}
+	if d.internLimit > 0 && len(d.intern) >= d.internLimit {
+		return
+	}
+	d.intern = append(d.intern, s)
+}
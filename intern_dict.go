@@ -0,0 +1,92 @@
+package msgpack
+
+import "sync"
+
+// InternDict is a string<->index table shared by multiple Encoders
+// and Decoders via UseInternDict, optionally pre-seeded and/or frozen
+// for concurrent read-only use.
+type InternDict struct {
+	mu       sync.RWMutex
+	frozen   bool
+	forward  map[string]int
+	backward []string
+}
+
+// NewInternDict returns an InternDict pre-seeded with seed, so that
+// seed[i] is always encoded and decoded as index i.
+func NewInternDict(seed ...string) *InternDict {
+	d := &InternDict{
+		forward:  make(map[string]int, len(seed)),
+		backward: make([]string, 0, len(seed)),
+	}
+	for _, s := range seed {
+		if _, ok := d.forward[s]; ok {
+			continue
+		}
+		d.forward[s] = len(d.backward)
+		d.backward = append(d.backward, s)
+	}
+	return d
+}
+
+// Freeze marks the dict read-only, safe for concurrent use.
+func (d *InternDict) Freeze() {
+	d.mu.Lock()
+	d.frozen = true
+	d.mu.Unlock()
+}
+
+// Lookup returns the index assigned to s, if any.
+func (d *InternDict) Lookup(s string) (int, bool) {
+	d.mu.RLock()
+	idx, ok := d.forward[s]
+	d.mu.RUnlock()
+	return idx, ok
+}
+
+// Intern assigns s the next available index unless s is already
+// present or the dict is frozen, in which case added is false.
+func (d *InternDict) Intern(s string) (idx int, added bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if idx, ok := d.forward[s]; ok {
+		return idx, false
+	}
+	if d.frozen {
+		return 0, false
+	}
+
+	idx = len(d.backward)
+	d.forward[s] = idx
+	d.backward = append(d.backward, s)
+	return idx, true
+}
+
+// At returns the string assigned to idx.
+func (d *InternDict) At(idx int) (string, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if idx < 0 || idx >= len(d.backward) {
+		return "", false
+	}
+	return d.backward[idx], true
+}
+
+// Len reports the number of entries currently in the dict.
+func (d *InternDict) Len() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.backward)
+}
+
+// UseInternDict attaches a shared InternDict to the encoder.
+func (e *Encoder) UseInternDict(dict *InternDict) {
+	e.internDict = dict
+}
+
+// UseInternDict attaches a shared InternDict to the decoder; it must
+// match the peer Encoder's dict.
+func (d *Decoder) UseInternDict(dict *InternDict) {
+	d.internDict = dict
+}
@@ -0,0 +1,93 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"testing"
+
+	msgpack "github.com/vmihailenco/msgpack/v5"
+)
+
+type internDictRec struct {
+	Val string `msgpack:",intern"`
+}
+
+func TestInternDictRoundTrip(t *testing.T) {
+	dict := msgpack.NewInternDict()
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.UseInternDict(dict)
+	dec := msgpack.NewDecoder(&buf)
+	dec.UseInternDict(dict)
+
+	want := []string{"longvalue", "other", "longvalue", "longvalue"}
+	for _, s := range want {
+		if err := enc.Encode(internDictRec{Val: s}); err != nil {
+			t.Fatalf("Encode(%q): %v", s, err)
+		}
+	}
+
+	for i, s := range want {
+		var got internDictRec
+		if err := dec.Decode(&got); err != nil {
+			t.Fatalf("Decode #%d: %v", i, err)
+		}
+		if got.Val != s {
+			t.Fatalf("Decode #%d: got %q, want %q", i, got.Val, s)
+		}
+	}
+}
+
+func TestInternDictPreseeded(t *testing.T) {
+	seed := []string{"red", "green", "blue"}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.UseInternDict(msgpack.NewInternDict(seed...))
+	dec := msgpack.NewDecoder(&buf)
+	dec.UseInternDict(msgpack.NewInternDict(seed...))
+
+	if err := enc.Encode(internDictRec{Val: "green"}); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	var got internDictRec
+	if err := dec.Decode(&got); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if got.Val != "green" {
+		t.Fatalf("got %q, want %q", got.Val, "green")
+	}
+}
+
+func TestInternDictFrozenFallsBackToPerStreamTable(t *testing.T) {
+	dict := msgpack.NewInternDict()
+	dict.Freeze()
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.UseInternDict(dict)
+	dec := msgpack.NewDecoder(&buf)
+	dec.UseInternDict(dict)
+
+	want := []string{"newstring", "newstring"}
+	for _, s := range want {
+		if err := enc.Encode(internDictRec{Val: s}); err != nil {
+			t.Fatalf("Encode(%q): %v", s, err)
+		}
+	}
+
+	for i, s := range want {
+		var got internDictRec
+		if err := dec.Decode(&got); err != nil {
+			t.Fatalf("Decode #%d: %v", i, err)
+		}
+		if got.Val != s {
+			t.Fatalf("Decode #%d: got %q, want %q", i, got.Val, s)
+		}
+	}
+
+	if _, ok := dict.Lookup("newstring"); ok {
+		t.Fatalf("frozen dict should not have learned %q", "newstring")
+	}
+}
@@ -0,0 +1,115 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"testing"
+
+	msgpack "github.com/vmihailenco/msgpack/v5"
+)
+
+type internLimitRec struct {
+	Val string `msgpack:",intern"`
+}
+
+func roundTripInternLimit(t *testing.T, maxEntries int, policy msgpack.InternPolicy, values []string) []string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetInternLimit(maxEntries, policy)
+	dec := msgpack.NewDecoder(&buf)
+	dec.SetInternLimit(maxEntries, policy)
+
+	for _, s := range values {
+		if err := enc.Encode(internLimitRec{Val: s}); err != nil {
+			t.Fatalf("Encode(%q): %v", s, err)
+		}
+	}
+
+	got := make([]string, len(values))
+	for i := range values {
+		var rec internLimitRec
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatalf("Decode #%d: %v", i, err)
+		}
+		got[i] = rec.Val
+	}
+	return got
+}
+
+func TestInternLimitReject(t *testing.T) {
+	values := []string{"aaaa", "bbbb", "cccc", "aaaa", "cccc"}
+	got := roundTripInternLimit(t, 2, msgpack.InternPolicyReject, values)
+	for i, s := range values {
+		if got[i] != s {
+			t.Fatalf("#%d: got %q, want %q", i, got[i], s)
+		}
+	}
+}
+
+func TestInternLimitLRU(t *testing.T) {
+	values := []string{"aaaa", "bbbb", "cccc", "dddd", "aaaa", "dddd"}
+	got := roundTripInternLimit(t, 2, msgpack.InternPolicyLRU, values)
+	for i, s := range values {
+		if got[i] != s {
+			t.Fatalf("#%d: got %q, want %q", i, got[i], s)
+		}
+	}
+}
+
+func TestInternLimitReset(t *testing.T) {
+	values := []string{"aaaa", "bbbb", "cccc", "aaaa", "bbbb"}
+	got := roundTripInternLimit(t, 2, msgpack.InternPolicyReset, values)
+	for i, s := range values {
+		if got[i] != s {
+			t.Fatalf("#%d: got %q, want %q", i, got[i], s)
+		}
+	}
+}
+
+// TestInternLimitLRUBackfill reproduces strings interned before
+// SetInternLimit switches the policy to InternPolicyLRU: eviction
+// must still be able to find a victim for them, not just for strings
+// touched after the switch.
+func TestInternLimitLRUBackfill(t *testing.T) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+
+	for _, s := range []string{"aaaa", "bbbb"} {
+		if err := enc.Encode(internLimitRec{Val: s}); err != nil {
+			t.Fatalf("Encode(%q): %v", s, err)
+		}
+	}
+
+	enc.SetInternLimit(2, msgpack.InternPolicyLRU)
+
+	for i := 0; i < 3; i++ {
+		if err := enc.Encode(internLimitRec{Val: "dddd"}); err != nil {
+			t.Fatalf("Encode #%d: %v", i, err)
+		}
+	}
+
+	stats := enc.InternStats()
+	if stats.Hits == 0 {
+		t.Fatalf("InternStats() = %+v, want at least one hit for repeated %q", stats, "dddd")
+	}
+}
+
+func TestInternStatsCountsDictHitsAndMisses(t *testing.T) {
+	dict := msgpack.NewInternDict()
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.UseInternDict(dict)
+
+	for _, s := range []string{"aaaa", "bbbb", "aaaa", "aaaa"} {
+		if err := enc.Encode(internLimitRec{Val: s}); err != nil {
+			t.Fatalf("Encode(%q): %v", s, err)
+		}
+	}
+
+	stats := enc.InternStats()
+	if stats.Hits == 0 && stats.Misses == 0 {
+		t.Fatalf("InternStats() = %+v, want dict-resolved strings to be counted", stats)
+	}
+}